@@ -0,0 +1,226 @@
+package stage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRatePPS     = 1000
+	defaultMaxInflight = 100
+	defaultMinInflight = 4
+	defaultDialTimeout = 2 * time.Second
+)
+
+// rttEstimator tracks a smoothed RTT and its variance the way TCP does
+// (Jacobson/Karels), so per-port dial timeouts track how slow a target
+// actually is instead of a single fixed value for every host.
+type rttEstimator struct {
+	mu     sync.Mutex
+	srtt   time.Duration
+	rttvar time.Duration
+	seeded bool
+}
+
+// update feeds one successful handshake RTT sample into the estimator.
+func (e *rttEstimator) update(sample time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.seeded {
+		e.srtt = sample
+		e.rttvar = sample / 2
+		e.seeded = true
+		return
+	}
+
+	delta := sample - e.srtt
+	e.srtt += delta / 8
+	if delta < 0 {
+		delta = -delta
+	}
+	e.rttvar += (delta - e.rttvar) / 4
+}
+
+// timeout returns srtt + 4*rttvar, the classic TCP retransmission-timeout
+// formula, falling back to a conservative default before any sample exists.
+func (e *rttEstimator) timeout() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.seeded {
+		return defaultDialTimeout
+	}
+	timeout := e.srtt + 4*e.rttvar
+	if timeout < 100*time.Millisecond {
+		timeout = 100 * time.Millisecond
+	}
+	return timeout
+}
+
+// aimdLimiter is an AIMD congestion-control-style cap on in-flight probes for
+// one target: additive increase on every success, multiplicative decrease on
+// every timeout, the same shape as TCP's congestion window.
+type aimdLimiter struct {
+	mu       sync.Mutex
+	limit    float64
+	inFlight int32
+	min      float64
+	max      float64
+}
+
+func newAIMDLimiter(initial, min, max int) *aimdLimiter {
+	return &aimdLimiter{limit: float64(initial), min: float64(min), max: float64(max)}
+}
+
+// acquire blocks until the current window has room, or ctx is cancelled.
+func (l *aimdLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if atomic.LoadInt32(&l.inFlight) < int32(l.limit) {
+			atomic.AddInt32(&l.inFlight, 1)
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-time.After(5 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *aimdLimiter) release() {
+	atomic.AddInt32(&l.inFlight, -1)
+}
+
+// onSuccess grows the window additively, one probe's worth per window's worth
+// of successes, same as TCP's congestion-avoidance increase.
+func (l *aimdLimiter) onSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit += 1 / l.limit
+	if l.limit > l.max {
+		l.limit = l.max
+	}
+}
+
+// onLoss halves the window, same as TCP's response to a detected drop.
+func (l *aimdLimiter) onLoss() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit /= 2
+	if l.limit < l.min {
+		l.limit = l.min
+	}
+}
+
+// tokenBucket is the shared `--rate pps` enforcement point for both
+// scanTCPPort and scanUDPPort, so the configured rate holds regardless of how
+// many hosts are being probed concurrently.
+type tokenBucket struct {
+	tokens chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newTokenBucket(pps int) *tokenBucket {
+	if pps <= 0 {
+		pps = defaultRatePPS
+	}
+	tb := &tokenBucket{
+		tokens: make(chan struct{}, pps),
+		stop:   make(chan struct{}),
+	}
+	interval := time.Second / time.Duration(pps)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case tb.tokens <- struct{}{}:
+				default:
+				}
+			case <-tb.stop:
+				return
+			}
+		}
+	}()
+	return tb
+}
+
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	select {
+	case <-tb.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (tb *tokenBucket) close() {
+	tb.once.Do(func() { close(tb.stop) })
+}
+
+// hostAdaptive bundles the per-target state the adaptive controller tracks:
+// an RTT estimate to size dial timeouts, and an AIMD window to size how many
+// probes are allowed in flight against that target at once.
+type hostAdaptive struct {
+	rtt     *rttEstimator
+	limiter *aimdLimiter
+}
+
+// adaptiveManager owns one hostAdaptive per scan target plus the single rate
+// limiter every probe against every target shares.
+type adaptiveManager struct {
+	mu          sync.Mutex
+	hosts       map[string]*hostAdaptive
+	rate        *tokenBucket
+	maxInflight int
+}
+
+func newAdaptiveManager(ratePPS, maxInflight int) *adaptiveManager {
+	if maxInflight <= 0 {
+		maxInflight = defaultMaxInflight
+	}
+	return &adaptiveManager{
+		hosts:       make(map[string]*hostAdaptive),
+		rate:        newTokenBucket(ratePPS),
+		maxInflight: maxInflight,
+	}
+}
+
+// maxHostsInflight bounds how many hosts in a CIDR are scanned at once. It
+// piggybacks on the same --max-inflight knob as the per-host port limiter,
+// scaled down since each host itself fans out into many port probes.
+func (s *Scanner) maxHostsInflight() int {
+	if s.config.MaxInflight <= 0 {
+		return 20
+	}
+	hosts := s.config.MaxInflight / 5
+	if hosts < 1 {
+		hosts = 1
+	}
+	return hosts
+}
+
+func (m *adaptiveManager) forHost(target string) *hostAdaptive {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	host, ok := m.hosts[target]
+	if !ok {
+		host = &hostAdaptive{
+			rtt:     &rttEstimator{},
+			limiter: newAIMDLimiter(defaultMinInflight, defaultMinInflight, m.maxInflight),
+		}
+		m.hosts[target] = host
+	}
+	return host
+}
@@ -0,0 +1,76 @@
+package stage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// BinaryEdgeProvider queries the BinaryEdge host API (https://docs.binaryedge.io).
+type BinaryEdgeProvider struct {
+	apiKey    string
+	rateLimit time.Duration
+	client    *http.Client
+}
+
+func NewBinaryEdgeProvider(apiKey string, qps float64) *BinaryEdgeProvider {
+	return &BinaryEdgeProvider{
+		apiKey:    apiKey,
+		rateLimit: qpsRateLimit(qps),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *BinaryEdgeProvider) Name() string { return "binaryedge" }
+
+func (p *BinaryEdgeProvider) RateLimit() time.Duration { return p.rateLimit }
+
+type binaryedgeHostResponse struct {
+	Events []struct {
+		Port int `json:"port"`
+		// Service mirrors the common subset of BinaryEdge's event-specific shapes
+		// (ports/service, ports/http, ...); only its name and transport are read.
+		Service struct {
+			Name     string `json:"name"`
+			Protocol string `json:"transport"`
+		} `json:"service"`
+	} `json:"events"`
+}
+
+func (p *BinaryEdgeProvider) Lookup(ip string) (*IntelResult, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://api.binaryedge.io/v2/query/ip/%s", ip), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("binaryedge request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("binaryedge returned status %d", resp.StatusCode)
+	}
+
+	var parsed binaryedgeHostResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("binaryedge response decode failed: %v", err)
+	}
+
+	result := &IntelResult{IP: ip}
+	for _, event := range parsed.Events {
+		if event.Port == 0 {
+			continue
+		}
+		result.Ports = append(result.Ports, IntelPort{
+			Port:     event.Port,
+			Protocol: event.Service.Protocol,
+			Service:  event.Service.Name,
+			Provider: p.Name(),
+		})
+	}
+	return result, nil
+}
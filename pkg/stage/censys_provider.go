@@ -0,0 +1,45 @@
+package stage
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// CensysProvider adapts the existing CensysClient to the IntelProvider interface
+// so Censys is just one more entry in the registry instead of a special case.
+type CensysProvider struct {
+	client *CensysClient
+}
+
+func NewCensysProvider(apiKey, secret string) *CensysProvider {
+	return &CensysProvider{client: NewCensysClient(apiKey, secret)}
+}
+
+func (p *CensysProvider) Name() string { return "censys" }
+
+func (p *CensysProvider) RateLimit() time.Duration { return 200 * time.Millisecond }
+
+func (p *CensysProvider) Lookup(ip string) (*IntelResult, error) {
+	hostInfo, err := p.client.GetHostInfo(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("censys: invalid IP %q: %v", ip, err)
+	}
+
+	node := Node{IP: addr, Tags: []string{}, Ports: []*ServiceInfo{}}
+	MergeCensysData(&node, hostInfo)
+
+	result := &IntelResult{IP: ip, Tags: node.Tags}
+	for _, port := range node.Ports {
+		result.Ports = append(result.Ports, IntelPort{
+			Port:     port.Port,
+			Provider: p.Name(),
+		})
+	}
+	return result, nil
+}
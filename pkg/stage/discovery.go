@@ -0,0 +1,369 @@
+package stage
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// mdnsGroup is the well-known IPv4 multicast group and port used for mDNS (RFC 6762).
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// metaServiceQuery is the DNS-SD meta-query used to enumerate advertised service
+// types on the network (RFC 6763 section 9).
+const metaServiceQuery = "_services._dns-sd._udp.local."
+
+// defaultServiceTypes is browsed alongside whatever the meta-query turns up, so
+// discovery still finds common services on responders that don't implement it.
+var defaultServiceTypes = []string{
+	"_http._tcp.local.",
+	"_ssh._tcp.local.",
+	"_workstation._tcp.local.",
+	"_ipp._tcp.local.",
+	"_smb._tcp.local.",
+	"_googlecast._tcp.local.",
+}
+
+// dnsRR is a minimal decoded resource record; only the fields discovery needs.
+// msg and dataOff are kept alongside Data (RDATA alone) because some record
+// types, notably SRV, embed a domain name that can be compressed with a pointer
+// absolute within the whole message -- decoding that name needs the full buffer,
+// not just the RDATA slice.
+type dnsRR struct {
+	Name    string
+	Type    uint16
+	Data    []byte
+	msg     []byte
+	dataOff int
+}
+
+const (
+	dnsTypePTR  = 12
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsTypeSRV  = 33
+	dnsTypeTXT  = 16
+)
+
+// discovered tracks what a browse pass has learned about one service instance
+// while it's still missing pieces of the PTR -> SRV -> A/AAAA/TXT chain.
+type discovered struct {
+	service  string
+	instance string
+	target   string
+	port     uint16
+	txt      []string
+	ips      []string
+}
+
+// DiscoverLAN enumerates hosts and services on the local network using mDNS/DNS-SD
+// (RFC 6762/6763) instead of taking an explicit target. It queries the meta service
+// to learn which service types are advertised, browses each type via the
+// PTR -> SRV -> A/AAAA/TXT chain, and feeds every discovered IP:port pair into
+// ServiceDetector, adding the advertised service type and TXT metadata to each
+// resulting ServiceInfo. Where the detector identifies nothing on a pair, a
+// ServiceInfo built from the mDNS data alone is recorded instead.
+func (s *Scanner) DiscoverLAN(ctx context.Context, timeout time.Duration) ([]Node, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mDNS socket: %v", err)
+	}
+	defer conn.Close()
+
+	serviceTypes := s.browseServiceTypes(conn, timeout)
+	serviceTypes = mergeServiceTypes(serviceTypes, defaultServiceTypes)
+	fmt.Printf("[+] mDNS: browsing %d service type(s)\n", len(serviceTypes))
+
+	instances := make(map[string]*discovered)
+	for _, svc := range serviceTypes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		s.browseService(conn, svc, timeout, instances)
+	}
+
+	return s.scanDiscoveredInstances(instances), nil
+}
+
+// browseServiceTypes sends the DNS-SD meta-query and collects the service types
+// (e.g. "_http._tcp.local.") reported back via PTR records.
+func (s *Scanner) browseServiceTypes(conn *net.UDPConn, timeout time.Duration) []string {
+	var types []string
+	for _, rr := range s.query(conn, metaServiceQuery, dnsTypePTR, timeout) {
+		if rr.Type != dnsTypePTR {
+			continue
+		}
+		if name, _, err := decodeDNSName(rr.msg, rr.dataOff); err == nil {
+			types = append(types, name)
+		}
+	}
+	return types
+}
+
+// browseService resolves one service type through the full PTR -> SRV -> A/AAAA/TXT
+// chain, accumulating results into instances keyed by instance name.
+func (s *Scanner) browseService(conn *net.UDPConn, serviceType string, timeout time.Duration, instances map[string]*discovered) {
+	for _, rr := range s.query(conn, serviceType, dnsTypePTR, timeout) {
+		if rr.Type != dnsTypePTR {
+			continue
+		}
+		instanceName, _, err := decodeDNSName(rr.msg, rr.dataOff)
+		if err != nil {
+			continue
+		}
+
+		entry := instances[instanceName]
+		if entry == nil {
+			entry = &discovered{service: serviceType, instance: instanceName}
+			instances[instanceName] = entry
+		}
+
+		for _, srv := range s.query(conn, instanceName, dnsTypeSRV, timeout) {
+			switch srv.Type {
+			case dnsTypeSRV:
+				target, port, err := decodeSRV(srv)
+				if err == nil {
+					entry.target = target
+					entry.port = port
+				}
+			case dnsTypeTXT:
+				entry.txt = append(entry.txt, decodeTXT(srv.Data)...)
+			case dnsTypeA, dnsTypeAAAA:
+				if ip := decodeAddr(srv.Data); ip != "" {
+					entry.ips = append(entry.ips, ip)
+				}
+			}
+		}
+
+		if entry.target != "" {
+			for _, addr := range s.query(conn, entry.target, dnsTypeA, timeout) {
+				if ip := decodeAddr(addr.Data); ip != "" {
+					entry.ips = append(entry.ips, ip)
+				}
+			}
+		}
+	}
+}
+
+// scanDiscoveredInstances runs ServiceDetector.DetectService (the detector
+// scanHost uses) on each resolved IP:port pair, probing only the advertised
+// port, then adds what mDNS already told us to each resulting ServiceInfo.
+func (s *Scanner) scanDiscoveredInstances(instances map[string]*discovered) []Node {
+	nodeMap := make(map[netip.Addr]*Node)
+
+	for _, entry := range instances {
+		if len(entry.ips) == 0 || entry.port == 0 {
+			continue
+		}
+
+		for _, ip := range entry.ips {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				continue
+			}
+			node, exists := nodeMap[addr]
+			if !exists {
+				node = &Node{IP: addr, Tags: []string{}, Ports: []*ServiceInfo{}}
+				nodeMap[addr] = node
+			}
+
+			services := s.detector.DetectService(ip, int(entry.port), "tcp")
+			if len(services) == 0 {
+				services = []ServiceInfo{{Port: int(entry.port)}}
+			}
+			for i := range services {
+				services[i].Types = append(services[i].Types, strings.TrimSuffix(entry.service, "."))
+				services[i].SensitiveInfo = append(services[i].SensitiveInfo, entry.txt...)
+				node.Ports = append(node.Ports, &services[i])
+			}
+		}
+	}
+
+	var results []Node
+	for _, node := range nodeMap {
+		results = append(results, *node)
+	}
+	return results
+}
+
+// query sends a single DNS question over conn and collects answers until timeout.
+func (s *Scanner) query(conn *net.UDPConn, name string, qtype uint16, timeout time.Duration) []dnsRR {
+	msg := encodeDNSQuery(name, qtype)
+	if _, err := conn.WriteToUDP(msg, mdnsGroup); err != nil {
+		log.Printf("Warning: mDNS query for %s failed: %v", name, err)
+		return nil
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	var answers []dnsRR
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		answers = append(answers, decodeDNSAnswers(buf[:n])...)
+	}
+	return answers
+}
+
+func mergeServiceTypes(discovered, defaults []string) []string {
+	seen := make(map[string]struct{}, len(discovered))
+	merged := append([]string{}, discovered...)
+	for _, t := range discovered {
+		seen[t] = struct{}{}
+	}
+	for _, t := range defaults {
+		if _, ok := seen[t]; !ok {
+			merged = append(merged, t)
+			seen[t] = struct{}{}
+		}
+	}
+	return merged
+}
+
+// --- minimal DNS message encoding/decoding, just enough for mDNS browsing ---
+
+func encodeDNSQuery(name string, qtype uint16) []byte {
+	buf := make([]byte, 12)
+	binary.BigEndian.PutUint16(buf[4:], 1) // QDCOUNT
+	buf = append(buf, encodeDNSName(name)...)
+	qsuffix := make([]byte, 4)
+	binary.BigEndian.PutUint16(qsuffix[0:], qtype)
+	binary.BigEndian.PutUint16(qsuffix[2:], 1) // IN
+	return append(buf, qsuffix...)
+}
+
+func encodeDNSName(name string) []byte {
+	var buf []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+func decodeDNSAnswers(buf []byte) []dnsRR {
+	if len(buf) < 12 {
+		return nil
+	}
+	qdcount := int(binary.BigEndian.Uint16(buf[4:6]))
+	ancount := int(binary.BigEndian.Uint16(buf[6:8])) + int(binary.BigEndian.Uint16(buf[8:10])) + int(binary.BigEndian.Uint16(buf[10:12]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		_, next, err := decodeDNSName(buf, off)
+		if err != nil {
+			return nil
+		}
+		off = next + 4 // QTYPE + QCLASS
+	}
+
+	var rrs []dnsRR
+	for i := 0; i < ancount; i++ {
+		name, next, err := decodeDNSName(buf, off)
+		if err != nil || next+10 > len(buf) {
+			break
+		}
+		rrType := binary.BigEndian.Uint16(buf[next : next+2])
+		rdlen := int(binary.BigEndian.Uint16(buf[next+8 : next+10]))
+		dataStart := next + 10
+		if dataStart+rdlen > len(buf) {
+			break
+		}
+		rrs = append(rrs, dnsRR{Name: name, Type: rrType, Data: buf[dataStart : dataStart+rdlen], msg: buf, dataOff: dataStart})
+		off = dataStart + rdlen
+	}
+	return rrs
+}
+
+// decodeDNSName decodes a (possibly compressed) DNS name, returning the name and
+// the offset immediately following it in the *original* message. When off indexes
+// directly into a standalone RDATA slice (no compression pointers), next is simply
+// the byte offset past the encoded name within that slice.
+func decodeDNSName(buf []byte, off int) (string, int, error) {
+	var labels []string
+	start := off
+	jumped := false
+	end := off
+
+	for {
+		if off >= len(buf) {
+			return "", 0, fmt.Errorf("dns name truncated")
+		}
+		length := int(buf[off])
+		if length == 0 {
+			off++
+			if !jumped {
+				end = off
+			}
+			break
+		}
+		if length&0xc0 == 0xc0 {
+			if off+1 >= len(buf) {
+				return "", 0, fmt.Errorf("dns name pointer truncated")
+			}
+			if !jumped {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(buf[off:off+2]) &^ 0xc000)
+			jumped = true
+			continue
+		}
+		off++
+		if off+length > len(buf) {
+			return "", 0, fmt.Errorf("dns label truncated")
+		}
+		labels = append(labels, string(buf[off:off+length]))
+		off += length
+	}
+
+	_ = start
+	return strings.Join(labels, ".") + ".", end, nil
+}
+
+// decodeSRV reads an SRV record's port and target. The target name is decoded
+// against the full message (rr.msg) at its absolute offset, not the RDATA slice
+// alone, because mDNS responders routinely compress the target with a pointer
+// that's absolute within the whole packet.
+func decodeSRV(rr dnsRR) (string, uint16, error) {
+	if len(rr.Data) < 7 {
+		return "", 0, fmt.Errorf("short SRV record")
+	}
+	port := binary.BigEndian.Uint16(rr.Data[4:6])
+	target, _, err := decodeDNSName(rr.msg, rr.dataOff+6)
+	return target, port, err
+}
+
+func decodeTXT(data []byte) []string {
+	var entries []string
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		i++
+		if i+length > len(data) {
+			break
+		}
+		if length > 0 {
+			entries = append(entries, string(data[i:i+length]))
+		}
+		i += length
+	}
+	return entries
+}
+
+func decodeAddr(data []byte) string {
+	switch len(data) {
+	case 4, 16:
+		return net.IP(data).String()
+	default:
+		return ""
+	}
+}
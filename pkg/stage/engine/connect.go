@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// connectWorkers bounds how many dials run concurrently, the same spirit as the
+// old per-host scanTCPPort semaphore -- a fixed pool draining a bounded queue
+// instead of one goroutine per Probe call, which would let a /16+ target list
+// spawn millions of goroutines at once.
+const connectWorkers = 200
+
+// connectTarget is one (ip, port) pair queued for connectProber's worker pool.
+type connectTarget struct {
+	ip   string
+	port int
+}
+
+// connectProber is the unprivileged fallback: a bounded pool of goroutines doing
+// plain net.Dial, same as the legacy scanTCPPort path. It exists so the engine
+// subsystem works without CAP_NET_RAW, just slower.
+type connectProber struct {
+	results chan Result
+	bucket  *tokenBucket
+	ctx     context.Context
+	probes  chan connectTarget
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+func newConnectProber() *connectProber {
+	return &connectProber{results: make(chan Result, 1024), probes: make(chan connectTarget, 4096)}
+}
+
+func (p *connectProber) Start(ctx context.Context, ratePPS int) error {
+	p.ctx = ctx
+	p.bucket = newTokenBucket(ratePPS)
+
+	p.wg.Add(connectWorkers)
+	for i := 0; i < connectWorkers; i++ {
+		go p.worker(ctx)
+	}
+
+	go func() {
+		<-ctx.Done()
+		p.wg.Wait()
+		p.once.Do(func() { close(p.results) })
+		p.bucket.close()
+	}()
+	return nil
+}
+
+func (p *connectProber) worker(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case target := <-p.probes:
+			// Tied to the scan's ctx, not context.Background(): once ctx is
+			// cancelled this returns instead of blocking forever, letting
+			// Start's wg.Wait() (and so Results' close) actually complete.
+			if err := p.bucket.wait(ctx); err != nil {
+				return
+			}
+			conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", target.ip, target.port), 2*time.Second)
+			if err != nil {
+				continue
+			}
+			conn.Close()
+			select {
+			case p.results <- Result{IP: target.ip, Port: target.port, Proto: "tcp", Open: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Probe enqueues target, blocking until a worker has drained room for it rather
+// than spawning an unbounded goroutine per call.
+func (p *connectProber) Probe(ip string, port int) error {
+	select {
+	case p.probes <- connectTarget{ip: ip, port: port}:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+func (p *connectProber) Results() <-chan Result {
+	return p.results
+}
+
+func (p *connectProber) Close() error {
+	p.once.Do(func() { close(p.results) })
+	return nil
+}
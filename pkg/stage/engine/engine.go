@@ -0,0 +1,104 @@
+// Package engine implements the raw packet-engine scanning backend: a
+// zmap/masscan-style stateless SYN scanner plus a protocol-aware UDP prober, both
+// driven from a single sender/receiver pair instead of one goroutine per port.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Result is a single probe outcome streamed back to the caller as it's observed.
+type Result struct {
+	IP    string
+	Port  int
+	Proto string // "tcp" or "udp"
+	Open  bool
+}
+
+// Prober is the packet-engine backend contract. A Prober owns its own send/receive
+// goroutines; Probe enqueues a target and Results streams whatever comes back.
+// Implementations are expected to be stateless on the receive side (SYN scanning)
+// or to correlate by payload (UDP), never by tracking one goroutine per flow.
+type Prober interface {
+	// Start launches the sender/receiver goroutines, emitting probes at up to
+	// ratePPS packets per second until ctx is cancelled or Close is called.
+	Start(ctx context.Context, ratePPS int) error
+	// Probe enqueues a single target for sending.
+	Probe(ip string, port int) error
+	// Results returns the channel open ports are published on. It is closed once
+	// the prober has drained in-flight probes after ctx is done.
+	Results() <-chan Result
+	Close() error
+}
+
+// NewTCPProber returns the SYN packet-engine prober when raw sockets are available
+// (requires CAP_NET_RAW on Linux), falling back to a connect()-based prober
+// otherwise so unprivileged runs keep working.
+func NewTCPProber() (Prober, error) {
+	p, err := newSYNProber()
+	if err == nil {
+		return p, nil
+	}
+	return newConnectProber(), nil
+}
+
+// NewUDPProber returns a protocol-aware UDP prober that sends the payload
+// associated with each target port (from the fingerprint templates) and
+// correlates replies by source address, since UDP has no handshake to key on.
+func NewUDPProber(payloads map[int][]byte) Prober {
+	return &udpProber{payloads: payloads}
+}
+
+// tokenBucket is a simple shared rate limiter used by both probers so a
+// `--rate pps` knob behaves the same regardless of backend.
+type tokenBucket struct {
+	tokens chan struct{}
+	stop   chan struct{}
+}
+
+func newTokenBucket(pps int) *tokenBucket {
+	if pps <= 0 {
+		pps = 1000
+	}
+	tb := &tokenBucket{
+		tokens: make(chan struct{}, pps),
+		stop:   make(chan struct{}),
+	}
+	interval := time.Second / time.Duration(pps)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case tb.tokens <- struct{}{}:
+				default:
+				}
+			case <-tb.stop:
+				return
+			}
+		}
+	}()
+	return tb
+}
+
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	select {
+	case <-tb.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (tb *tokenBucket) close() {
+	close(tb.stop)
+}
+
+// ErrRawSocketUnavailable is returned by the SYN prober constructor when raw
+// sockets can't be opened (missing privilege or unsupported platform), signalling
+// callers to fall back to the connect() path.
+var ErrRawSocketUnavailable = fmt.Errorf("raw socket unavailable, falling back to connect()")
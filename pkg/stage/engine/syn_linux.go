@@ -0,0 +1,274 @@
+//go:build linux
+
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"syscall"
+)
+
+// synProber is the raw-socket SYN scanner. One sender goroutine writes bare SYN
+// segments through an IPPROTO_TCP raw socket with a SipHash-derived ISN encoding
+// (dstIP, dstPort); one receiver goroutine reads SYN-ACKs off a second
+// IPPROTO_TCP raw socket and validates the cookie in the ACK field instead of tracking per-flow state.
+type synProber struct {
+	sendFD  int
+	recvFD  int
+	results chan Result
+	probes  chan synTarget
+	wg      sync.WaitGroup
+	once    sync.Once
+	bucket  *tokenBucket
+	ctx     context.Context
+
+	srcOnce sync.Once
+	srcIP   net.IP
+}
+
+type synTarget struct {
+	ip   net.IP
+	port int
+}
+
+func newSYNProber() (*synProber, error) {
+	sendFD, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_TCP)
+	if err != nil {
+		return nil, ErrRawSocketUnavailable
+	}
+	if err := syscall.SetsockoptInt(sendFD, syscall.IPPROTO_IP, syscall.IP_HDRINCL, 1); err != nil {
+		syscall.Close(sendFD)
+		return nil, ErrRawSocketUnavailable
+	}
+
+	recvFD, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_TCP)
+	if err != nil {
+		syscall.Close(sendFD)
+		return nil, ErrRawSocketUnavailable
+	}
+	// A receive timeout lets recvLoop wake up and notice ctx being cancelled even
+	// when no packet arrives.
+	tv := syscall.NsecToTimeval(200 * 1000 * 1000)
+	if err := syscall.SetsockoptTimeval(recvFD, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(sendFD)
+		syscall.Close(recvFD)
+		return nil, ErrRawSocketUnavailable
+	}
+
+	return &synProber{
+		sendFD:  sendFD,
+		recvFD:  recvFD,
+		results: make(chan Result, 4096),
+		probes:  make(chan synTarget, 4096),
+	}, nil
+}
+
+func (p *synProber) Start(ctx context.Context, ratePPS int) error {
+	p.ctx = ctx
+	p.bucket = newTokenBucket(ratePPS)
+
+	p.wg.Add(2)
+	go p.sendLoop(ctx)
+	go p.recvLoop(ctx)
+
+	go func() {
+		<-ctx.Done()
+		p.wg.Wait()
+		p.once.Do(func() {
+			close(p.results)
+			p.bucket.close()
+			syscall.Close(p.sendFD)
+			syscall.Close(p.recvFD)
+		})
+	}()
+	return nil
+}
+
+// Probe enqueues target, blocking until sendLoop has drained room for it rather
+// than silently dropping it -- for a /16+ scan the queue fills long before
+// sendLoop (itself rate-limited by bucket) works through it, and dropping here
+// would throw away most of the range instead of just pacing the caller.
+func (p *synProber) Probe(ip string, port int) error {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return nil // raw IPv4 only: IPv6 targets are skipped and never probed
+	}
+	select {
+	case p.probes <- synTarget{ip: parsed, port: port}:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+func (p *synProber) Results() <-chan Result {
+	return p.results
+}
+
+func (p *synProber) Close() error {
+	p.once.Do(func() {
+		close(p.results)
+		if p.bucket != nil {
+			p.bucket.close()
+		}
+		syscall.Close(p.sendFD)
+		syscall.Close(p.recvFD)
+	})
+	return nil
+}
+
+func (p *synProber) sendLoop(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case target := <-p.probes:
+			if p.bucket.wait(ctx) != nil {
+				return
+			}
+			p.sendSYN(target.ip, target.port)
+		}
+	}
+}
+
+func (p *synProber) sendSYN(dstIP net.IP, dstPort int) {
+	seq := encodeCookie(dstIP, uint16(dstPort))
+	packet := buildSYNPacket(p.localSrcIP(dstIP), dstIP, uint16(dstPort), seq)
+
+	addr := syscall.SockaddrInet4{Port: dstPort}
+	copy(addr.Addr[:], dstIP.To4())
+	syscall.Sendto(p.sendFD, packet, 0, &addr)
+}
+
+// localSrcIP resolves (once) the local address outbound packets to dstIP use, by
+// asking the routing table the same way connecting a UDP socket would. It's
+// cached and reused for every subsequent packet instead of a real source address
+// per target, which is wrong for multi-homed hosts but otherwise correct and
+// avoids a route lookup per probe.
+func (p *synProber) localSrcIP(dstIP net.IP) net.IP {
+	p.srcOnce.Do(func() {
+		conn, err := net.Dial("udp4", net.JoinHostPort(dstIP.String(), "80"))
+		if err != nil {
+			p.srcIP = net.IPv4zero
+			return
+		}
+		defer conn.Close()
+		p.srcIP = conn.LocalAddr().(*net.UDPAddr).IP
+	})
+	return p.srcIP
+}
+
+func (p *synProber) recvLoop(ctx context.Context) {
+	defer p.wg.Done()
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		n, from, err := syscall.Recvfrom(p.recvFD, buf, 0)
+		if err != nil {
+			continue
+		}
+		srcAddr, ok := from.(*syscall.SockaddrInet4)
+		if !ok {
+			continue
+		}
+
+		srcPort, ackNum, flags, ok := parseSYNACK(buf[:n])
+		if !ok || flags&tcpFlagSYN == 0 || flags&tcpFlagACK == 0 {
+			continue
+		}
+		if !validateCookie(ackNum, srcAddr.Addr[:], srcPort) {
+			continue // not one of ours; a retransmitted SYN-ACK passes again and is reported again
+		}
+
+		p.results <- Result{IP: net.IP(srcAddr.Addr[:]).String(), Port: int(srcPort), Proto: "tcp", Open: true}
+	}
+}
+
+const (
+	tcpFlagSYN = 0x02
+	tcpFlagACK = 0x10
+)
+
+// synSrcPort is the fixed TCP source port every SYN is sent from.
+const synSrcPort = 61000
+
+// buildSYNPacket assembles a minimal IPv4+TCP SYN segment with no options. A
+// zero checksum is silently discarded by essentially every real TCP/IP stack, so
+// unlike IP_HDRINCL's id/checksum convenience on some platforms, we can't rely on
+// the kernel to fill it in here -- both checksums are computed explicitly.
+func buildSYNPacket(srcIP, dstIP net.IP, dstPort uint16, seq uint32) []byte {
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], 40) // total length
+	ip[8] = 64                             // TTL
+	ip[9] = syscall.IPPROTO_TCP
+	copy(ip[12:16], srcIP.To4())
+	copy(ip[16:20], dstIP.To4())
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], synSrcPort) // IP_HDRINCL sends the header as written, so the source port is set here
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4 // data offset, no options
+	tcp[13] = tcpFlagSYN
+	binary.BigEndian.PutUint16(tcp[14:], 65535) // window
+	binary.BigEndian.PutUint16(tcp[16:], tcpChecksum(srcIP.To4(), dstIP.To4(), tcp))
+
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+
+	return append(ip, tcp...)
+}
+
+// tcpChecksum computes the TCP checksum over segment, including the IPv4 pseudo
+// header (src/dst address, protocol, TCP length) the RFC 793 checksum covers.
+// segment's own checksum field must be zero when this is called.
+func tcpChecksum(srcIP, dstIP net.IP, segment []byte) uint16 {
+	pseudo := make([]byte, 12+len(segment))
+	copy(pseudo[0:4], srcIP)
+	copy(pseudo[4:8], dstIP)
+	pseudo[9] = syscall.IPPROTO_TCP
+	binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(segment)))
+	copy(pseudo[12:], segment)
+	return checksum(pseudo)
+}
+
+// checksum computes the standard Internet checksum (RFC 1071) used by both the
+// IPv4 header and, over a pseudo header, TCP.
+func checksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// parseSYNACK extracts the source port, ack number and flags from a raw IPv4+TCP
+// segment read off the raw socket.
+func parseSYNACK(buf []byte) (srcPort uint16, ackNum uint32, flags byte, ok bool) {
+	if len(buf) < 20 {
+		return 0, 0, 0, false
+	}
+	ihl := int(buf[0]&0x0f) * 4
+	if len(buf) < ihl+20 {
+		return 0, 0, 0, false
+	}
+	tcp := buf[ihl:]
+	srcPort = binary.BigEndian.Uint16(tcp[0:2])
+	ackNum = binary.BigEndian.Uint32(tcp[8:12])
+	flags = tcp[13]
+	return srcPort, ackNum, flags, true
+}
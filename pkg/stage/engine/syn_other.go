@@ -0,0 +1,10 @@
+//go:build !linux
+
+package engine
+
+// newSYNProber is only implemented on Linux, where AF_PACKET/raw sockets give us
+// cheap access to the IP/TCP headers we need. Other platforms fall back to
+// newConnectProber.
+func newSYNProber() (Prober, error) {
+	return nil, ErrRawSocketUnavailable
+}
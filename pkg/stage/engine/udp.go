@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// udpWorkers bounds how many probes are in flight (each tying up a goroutine for
+// up to the 2s read deadline below) at once, the same spirit as connectWorkers --
+// a fixed pool draining a bounded queue instead of one goroutine per Probe call.
+const udpWorkers = 200
+
+// udpTarget is one (ip, port) pair queued for udpProber's worker pool.
+type udpTarget struct {
+	ip   string
+	port int
+}
+
+// udpProber sends the protocol-specific payload associated with each target port
+// (sourced from the fingerprint templates) and treats any reply as "open", since
+// UDP has no handshake to correlate against the way TCP's cookie trick does.
+type udpProber struct {
+	payloads map[int][]byte
+	results  chan Result
+	bucket   *tokenBucket
+	ctx      context.Context
+	probes   chan udpTarget
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+func (p *udpProber) Start(ctx context.Context, ratePPS int) error {
+	p.ctx = ctx
+	p.results = make(chan Result, 1024)
+	p.probes = make(chan udpTarget, 4096)
+	p.bucket = newTokenBucket(ratePPS)
+
+	p.wg.Add(udpWorkers)
+	for i := 0; i < udpWorkers; i++ {
+		go p.worker(ctx)
+	}
+
+	go func() {
+		<-ctx.Done()
+		p.wg.Wait()
+		p.once.Do(func() {
+			close(p.results)
+			p.bucket.close()
+		})
+	}()
+	return nil
+}
+
+func (p *udpProber) worker(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case target := <-p.probes:
+			// Tied to the scan's ctx, not context.Background(): once ctx is
+			// cancelled this returns instead of blocking forever, letting
+			// Start's wg.Wait() (and so Results' close) actually complete.
+			if err := p.bucket.wait(ctx); err != nil {
+				return
+			}
+
+			conn, err := net.DialTimeout("udp", fmt.Sprintf("%s:%d", target.ip, target.port), 2*time.Second)
+			if err != nil {
+				continue
+			}
+
+			if payload := p.payloads[target.port]; len(payload) > 0 {
+				conn.Write(payload)
+			}
+
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			buf := make([]byte, 1024)
+			_, readErr := conn.Read(buf)
+			conn.Close()
+			if readErr != nil {
+				continue
+			}
+
+			select {
+			case p.results <- Result{IP: target.ip, Port: target.port, Proto: "udp", Open: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Probe enqueues target, blocking until a worker has drained room for it rather
+// than spawning an unbounded goroutine per call.
+func (p *udpProber) Probe(ip string, port int) error {
+	select {
+	case p.probes <- udpTarget{ip: ip, port: port}:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+func (p *udpProber) Results() <-chan Result {
+	return p.results
+}
+
+func (p *udpProber) Close() error {
+	p.once.Do(func() {
+		close(p.results)
+		p.bucket.close()
+	})
+	return nil
+}
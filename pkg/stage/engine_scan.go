@@ -0,0 +1,100 @@
+package stage
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Linkverba/zscan/pkg/stage/engine"
+)
+
+// scanPacketEngine is the "engine: packet" path selected in Config: instead of the
+// per-port goroutine/semaphore approach in scanParallel/scanHost, a single SYN
+// prober (falling back to connect() when unprivileged) and a single UDP prober
+// stream open ports across every host in ips, which are then handed to the
+// existing ServiceDetector for banner grabbing exactly as scanHost does.
+func (s *Scanner) scanPacketEngine(parent context.Context, ips []netip.Addr) []Node {
+	ctx, cancel := context.WithTimeout(parent, 5*time.Minute)
+	defer cancel()
+
+	tcpProber, err := engine.NewTCPProber()
+	if err != nil {
+		log.Printf("Warning: packet engine unavailable, falling back to connect(): %v", err)
+		return s.scanParallel(ctx, ips, nil)
+	}
+	if err := tcpProber.Start(ctx, s.config.RatePPS); err != nil {
+		log.Printf("Warning: failed to start TCP prober: %v", err)
+		return s.scanParallel(ctx, ips, nil)
+	}
+
+	udpProber := engine.NewUDPProber(s.udpPayloads())
+	if err := udpProber.Start(ctx, s.config.RatePPS); err != nil {
+		log.Printf("Warning: failed to start UDP prober: %v", err)
+	}
+
+	var nodesMu sync.Mutex
+	nodes := make(map[netip.Addr]*Node)
+
+	var drainWg sync.WaitGroup
+	drain := func(results <-chan engine.Result, proto string) {
+		defer drainWg.Done()
+		for result := range results {
+			addr, err := netip.ParseAddr(result.IP)
+			if err != nil {
+				continue
+			}
+			for _, service := range s.detector.DetectService(result.IP, result.Port, proto) {
+				svc := service
+				nodesMu.Lock()
+				node, exists := nodes[addr]
+				if !exists {
+					node = &Node{IP: addr, Tags: []string{}, Ports: []*ServiceInfo{}}
+					nodes[addr] = node
+				}
+				node.Ports = append(node.Ports, &svc)
+				nodesMu.Unlock()
+			}
+		}
+	}
+	drainWg.Add(2)
+	go drain(tcpProber.Results(), "tcp")
+	go drain(udpProber.Results(), "udp")
+
+	for _, ip := range ips {
+		for _, port := range s.config.TCPPorts {
+			tcpProber.Probe(ip.String(), port)
+		}
+		for _, port := range s.config.UDPPorts {
+			udpProber.Probe(ip.String(), port)
+		}
+	}
+
+	// Give in-flight probes time to come back before tearing the engine down;
+	// cancelling ctx is what makes each Prober drain and close its Results channel.
+	select {
+	case <-time.After(3 * time.Second):
+	case <-parent.Done():
+	}
+	cancel()
+	drainWg.Wait()
+
+	var results []Node
+	for _, node := range nodes {
+		results = append(results, *node)
+	}
+	return results
+}
+
+// udpPayloads builds the port->payload map the UDP prober uses, sourced from the
+// same fingerprint templates DetectService uses for banner grabbing.
+func (s *Scanner) udpPayloads() map[int][]byte {
+	payloads := make(map[int][]byte)
+	for _, port := range s.config.UDPPorts {
+		if payload, ok := s.detector.UDPProbePayload(port); ok {
+			payloads[port] = payload
+		}
+	}
+	return payloads
+}
@@ -0,0 +1,47 @@
+package stage
+
+import "context"
+
+// EventType identifies what a streamed Event represents.
+type EventType string
+
+const (
+	EventHostFound         EventType = "host_found"
+	EventPortOpen          EventType = "port_open"
+	EventServiceIdentified EventType = "service_identified"
+	EventIntelMerged       EventType = "intel_merged"
+	EventProgress          EventType = "progress"
+	EventError             EventType = "error"
+)
+
+// Progress reports how far a streaming scan has gotten.
+type Progress struct {
+	Scanned int
+	Total   int
+	PPS     float64
+}
+
+// Event is one item emitted by ScanStream. Only the fields relevant to Type are
+// set; ServiceIdentified carries both Port and Service.
+type Event struct {
+	Type     EventType
+	Node     *Node
+	Port     int
+	Service  *ServiceInfo
+	Progress Progress
+	Err      error
+}
+
+// emit is a small helper so call sites don't need a nil check on every send:
+// events is nil on the plain (non-streaming) scan path. It selects on ctx.Done()
+// alongside the send so a goroutine can't block forever against a full buffer
+// once the caller has cancelled ctx and stopped draining the channel.
+func emit(ctx context.Context, events chan<- Event, event Event) {
+	if events == nil {
+		return
+	}
+	select {
+	case events <- event:
+	case <-ctx.Done():
+	}
+}
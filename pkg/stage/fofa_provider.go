@@ -0,0 +1,79 @@
+package stage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// FOFAProvider queries the FOFA search API (https://fofa.info/api). FOFA's query
+// language takes a base64-encoded query string rather than a plain IP lookup.
+type FOFAProvider struct {
+	email     string
+	key       string
+	rateLimit time.Duration
+	client    *http.Client
+}
+
+func NewFOFAProvider(email, key string, qps float64) *FOFAProvider {
+	return &FOFAProvider{
+		email:     email,
+		key:       key,
+		rateLimit: qpsRateLimit(qps),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *FOFAProvider) Name() string { return "fofa" }
+
+func (p *FOFAProvider) RateLimit() time.Duration { return p.rateLimit }
+
+type fofaSearchResponse struct {
+	Error   bool       `json:"error"`
+	ErrMsg  string     `json:"errmsg"`
+	Results [][]string `json:"results"`
+}
+
+func (p *FOFAProvider) Lookup(ip string) (*IntelResult, error) {
+	query := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("ip=\"%s\"", ip)))
+	endpoint := fmt.Sprintf(
+		"https://fofa.info/api/v1/search/all?email=%s&key=%s&qbase64=%s&fields=port,protocol,server",
+		url.QueryEscape(p.email), url.QueryEscape(p.key), query,
+	)
+
+	resp, err := p.client.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("fofa request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var parsed fofaSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("fofa response decode failed: %v", err)
+	}
+	if parsed.Error {
+		return nil, fmt.Errorf("fofa error: %s", parsed.ErrMsg)
+	}
+
+	result := &IntelResult{IP: ip}
+	for _, row := range parsed.Results {
+		if len(row) < 3 {
+			continue
+		}
+		port, err := strconv.Atoi(row[0])
+		if err != nil {
+			continue
+		}
+		result.Ports = append(result.Ports, IntelPort{
+			Port:     port,
+			Protocol: row[1],
+			Service:  row[2],
+			Provider: p.Name(),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package stage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ShodanProvider queries the Shodan host API (https://developer.shodan.io/api).
+type ShodanProvider struct {
+	apiKey    string
+	rateLimit time.Duration
+	client    *http.Client
+}
+
+func NewShodanProvider(apiKey string, qps float64) *ShodanProvider {
+	return &ShodanProvider{
+		apiKey:    apiKey,
+		rateLimit: qpsRateLimit(qps),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *ShodanProvider) Name() string { return "shodan" }
+
+func (p *ShodanProvider) RateLimit() time.Duration { return p.rateLimit }
+
+type shodanHostResponse struct {
+	Tags []string `json:"tags"`
+	Data []struct {
+		Port      int    `json:"port"`
+		Transport string `json:"transport"`
+		Product   string `json:"product"`
+	} `json:"data"`
+}
+
+func (p *ShodanProvider) Lookup(ip string) (*IntelResult, error) {
+	url := fmt.Sprintf("https://api.shodan.io/shodan/host/%s?key=%s", ip, p.apiKey)
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("shodan request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("shodan returned status %d", resp.StatusCode)
+	}
+
+	var parsed shodanHostResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("shodan response decode failed: %v", err)
+	}
+
+	result := &IntelResult{IP: ip, Tags: parsed.Tags}
+	for _, entry := range parsed.Data {
+		result.Ports = append(result.Ports, IntelPort{
+			Port:     entry.Port,
+			Protocol: entry.Transport,
+			Service:  entry.Product,
+			Provider: p.Name(),
+		})
+	}
+	return result, nil
+}
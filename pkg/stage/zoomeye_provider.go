@@ -0,0 +1,69 @@
+package stage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ZoomEyeProvider queries the ZoomEye host search API (https://www.zoomeye.org/api/doc).
+type ZoomEyeProvider struct {
+	apiKey    string
+	rateLimit time.Duration
+	client    *http.Client
+}
+
+func NewZoomEyeProvider(apiKey string, qps float64) *ZoomEyeProvider {
+	return &ZoomEyeProvider{
+		apiKey:    apiKey,
+		rateLimit: qpsRateLimit(qps),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *ZoomEyeProvider) Name() string { return "zoomeye" }
+
+func (p *ZoomEyeProvider) RateLimit() time.Duration { return p.rateLimit }
+
+type zoomeyeSearchResponse struct {
+	Matches []struct {
+		Port     int    `json:"port"`
+		Protocol string `json:"protocol"`
+		Service  string `json:"service"`
+	} `json:"matches"`
+}
+
+func (p *ZoomEyeProvider) Lookup(ip string) (*IntelResult, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://api.zoomeye.org/host/search?query=ip:%s", ip), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("API-KEY", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("zoomeye request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("zoomeye returned status %d", resp.StatusCode)
+	}
+
+	var parsed zoomeyeSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("zoomeye response decode failed: %v", err)
+	}
+
+	result := &IntelResult{IP: ip}
+	for _, match := range parsed.Matches {
+		result.Ports = append(result.Ports, IntelPort{
+			Port:     match.Port,
+			Protocol: match.Protocol,
+			Service:  match.Service,
+			Provider: p.Name(),
+		})
+	}
+	return result, nil
+}